@@ -0,0 +1,96 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import "testing"
+
+// driveFrame steps vm's current frame from front to back the same way
+// Engine.Step does: for each opcode, run opcodeCodeSeparator while the
+// tokenizer sits on OP_CODESEPARATOR (post-decode, i.e. already past it), then
+// advance to the next opcode. Using this instead of hand-setting
+// frame.lastCodeSep is what exercises opcodeCodeSeparator's real offset
+// computation, since that's the only place lastCodeSep is ever written.
+func driveFrame(t *testing.T, vm *Engine) {
+	t.Helper()
+	frame := vm.estack.Peek()
+	for {
+		if frame.opcode() == OP_CODESEPARATOR {
+			if err := opcodeCodeSeparator(frame.opcode(), frame.data(), vm); err != nil {
+				t.Fatalf("opcodeCodeSeparator: %v", err)
+			}
+		}
+		if frame.done() {
+			return
+		}
+		if !frame.step() {
+			if err := frame.tok.Err(); err != nil {
+				t.Fatalf("frame.step(): %v", err)
+			}
+			return
+		}
+	}
+}
+
+// TestSubScriptAfterCodeSeparator drives a frame through a script with
+// content both before and after OP_CODESEPARATOR the same way Engine.Step
+// would, letting the tokenizer compute lastCodeSep itself rather than the
+// test setting it directly, then checks that the signed subscript is exactly
+// the tail that follows the separator.
+//
+// This is also the test that would fail under the old "strip every
+// OP_CODESEPARATOR byte out of the whole script" rule: that rule signs
+// everything from the start of the script (minus the separator byte), which
+// is a longer, different byte range than frame.script()[lastCodeSep:].
+func TestSubScriptAfterCodeSeparator(t *testing.T) {
+	before := []byte{0x03, 'b', 'e', 'f'}
+	after := []byte{0x03, 'a', 'f', 't'}
+	script := append(append(append(append([]byte{}, before...), OP_CODESEPARATOR), after...), OP_CHECKSIG)
+
+	vm := &Engine{flags: ScriptVerifyCodeSepSlice}
+	if err := vm.PushScript(script); err != nil {
+		t.Fatalf("PushScript: %v", err)
+	}
+	driveFrame(t, vm)
+
+	frame := vm.estack.Peek()
+	wantLastCodeSep := int32(len(before)) + 1 // just after the 1-byte OP_CODESEPARATOR
+	if frame.lastCodeSep != wantLastCodeSep {
+		t.Fatalf("lastCodeSep = %d, want %d", frame.lastCodeSep, wantLastCodeSep)
+	}
+
+	got := vm.subScript()
+	want := script[wantLastCodeSep:]
+	if string(got) != string(want) {
+		t.Fatalf("subScript() = %x, want %x", got, want)
+	}
+
+	// The legacy (flag off) rule signs a different, longer range: it covers
+	// the whole script with just the separator byte stripped out, rather
+	// than starting from lastCodeSep. A signature computed over the sliced
+	// subscript must not also validate against the legacy one, or the
+	// CODESEPARATOR split would be meaningless.
+	vm.flags = 0
+	legacy := vm.subScript()
+	if string(legacy) == string(want) {
+		t.Fatal("legacy subScript() unexpectedly matches the sliced subscript; CODESEPARATOR split had no effect")
+	}
+}
+
+// TestSubScriptNoCodeSeparator verifies that a script with no
+// OP_CODESEPARATOR signs the whole script, via the default lastCodeSep of 0.
+func TestSubScriptNoCodeSeparator(t *testing.T) {
+	script := []byte{OP_1, OP_2, OP_CHECKSIG}
+
+	vm := &Engine{flags: ScriptVerifyCodeSepSlice}
+	if err := vm.PushScript(script); err != nil {
+		t.Fatalf("PushScript: %v", err)
+	}
+	driveFrame(t, vm)
+
+	got := vm.subScript()
+	if string(got) != string(script) {
+		t.Fatalf("subScript() = %x, want %x", got, script)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+// Hook is called by Step, once before and once after executeOpcode, so
+// external tooling can layer instruction-count limits, gas-like metering, or
+// coverage collection on top of the engine without forking it. Returning a
+// non-nil error aborts the step with that error.
+type Hook func(vm *Engine) error
+
+// breakpoint identifies a single opcode by its position: the script it
+// belongs to, and its byte offset within that script. The script index is
+// the same one DisasmScript and vm.scripts use (a script's fixed position
+// among every script the engine has ever pushed via Prepare/PushScript), NOT
+// the frame's depth in the execution stack. Depth is reused across sibling
+// scripts as they finish and are popped - two OP_CHECKPREDICATE calls at the
+// same call depth would be indistinguishable by depth alone - whereas this
+// index is assigned once, when the frame is pushed, and never reused.
+type breakpoint struct {
+	scriptIdx int
+	offset    int32
+}
+
+// Snapshot is a point-in-time view of the engine's state, returned by Trace.
+// The stacks are copies: mutating them has no effect on the running engine.
+type Snapshot struct {
+	ScriptIdx  int // index into the scripts the engine has pushed; see breakpoint
+	Offset     int32
+	NextOpcode string
+	DStack     [][]byte
+	AStack     [][]byte
+	CondStack  []int
+	NumOps     int
+	Available  []uint64
+}
+
+// SetBreakpoint arms a breakpoint at the given script index (see breakpoint)
+// and byte offset. The offset is the one ByteIndex reports while the frame is
+// positioned on an opcode, i.e. the offset just past that opcode; Continue
+// stops just before executing it.
+func (vm *Engine) SetBreakpoint(scriptIdx int, offset int32) {
+	vm.breakpoints = append(vm.breakpoints, breakpoint{scriptIdx: scriptIdx, offset: offset})
+}
+
+// ClearBreakpoint removes a previously armed breakpoint, if any.
+func (vm *Engine) ClearBreakpoint(scriptIdx int, offset int32) {
+	bp := breakpoint{scriptIdx: scriptIdx, offset: offset}
+	for i, b := range vm.breakpoints {
+		if b == bp {
+			vm.breakpoints = append(vm.breakpoints[:i], vm.breakpoints[i+1:]...)
+			return
+		}
+	}
+}
+
+// atBreakpoint reports whether the engine is currently positioned on an
+// armed breakpoint.
+func (vm *Engine) atBreakpoint() bool {
+	scriptIdx, offset, err := vm.estack.curPC()
+	if err != nil {
+		return false
+	}
+	for _, b := range vm.breakpoints {
+		if b.scriptIdx == scriptIdx && b.offset == offset {
+			return true
+		}
+	}
+	return false
+}
+
+// runHooks invokes every registered hook, stopping at (and returning) the
+// first error.
+func (vm *Engine) runHooks() error {
+	for _, h := range vm.hooks {
+		if err := h(vm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddHook registers a Hook to be invoked around every Step, including
+// ordinary calls to Step from Execute, not just from StepInto.
+func (vm *Engine) AddHook(h Hook) {
+	vm.hooks = append(vm.hooks, h)
+}
+
+// StepInto executes exactly one opcode, descending into a called script (if
+// the opcode pushes one) rather than stepping over it. It is just Step: the
+// two are the same operation, this name just reads better alongside
+// StepOver/StepOut in a debugger-shaped caller.
+func (vm *Engine) StepInto() (done bool, err error) {
+	return vm.Step()
+}
+
+// StepOver executes opcodes until control returns to the current frame depth,
+// i.e. any script pushed by the opcode about to execute runs to completion
+// before StepOver returns.
+func (vm *Engine) StepOver() (done bool, err error) {
+	startDepth := vm.estack.Depth()
+	for {
+		done, err = vm.StepInto()
+		if done || err != nil {
+			return done, err
+		}
+		if vm.estack.Depth() <= startDepth {
+			return false, nil
+		}
+	}
+}
+
+// StepOut runs until the current frame finishes and control returns to its
+// caller, i.e. until the execution stack depth drops below its starting
+// value.
+func (vm *Engine) StepOut() (done bool, err error) {
+	startDepth := vm.estack.Depth()
+	for {
+		done, err = vm.StepInto()
+		if done || err != nil {
+			return done, err
+		}
+		if vm.estack.Depth() < startDepth {
+			return false, nil
+		}
+	}
+}
+
+// Continue runs the engine until it hits an armed breakpoint or finishes
+// executing, returning done=true and the result of CheckErrorCondition once
+// execution completes.
+//
+// It always executes at least one opcode before re-checking for a
+// breakpoint, so calling Continue again after it stops on a breakpoint
+// resumes past it rather than re-detecting the same position and returning
+// immediately.
+func (vm *Engine) Continue() (done bool, err error) {
+	for {
+		done, err = vm.StepInto()
+		if done {
+			if err != nil {
+				return true, err
+			}
+			return true, vm.CheckErrorCondition(true)
+		}
+		if err != nil {
+			return true, err
+		}
+		if vm.atBreakpoint() {
+			return false, nil
+		}
+	}
+}
+
+// Trace returns a snapshot of the engine's current state, suitable for
+// display by a REPL or block explorer driving the engine opcode-by-opcode.
+func (vm *Engine) Trace() Snapshot {
+	scriptIdx, offset, _ := vm.estack.curPC()
+	dis, _ := vm.DisasmPC()
+
+	var condStack []int
+	if !vm.estack.empty() {
+		frame := vm.estack.Peek()
+		condStack = make([]int, len(frame.condStack))
+		copy(condStack, frame.condStack)
+	}
+
+	available := make([]uint64, len(vm.available))
+	copy(available, vm.available)
+
+	return Snapshot{
+		ScriptIdx:  scriptIdx,
+		Offset:     offset,
+		NextOpcode: dis,
+		DStack:     getStack(&vm.dstack),
+		AStack:     getStack(&vm.astack),
+		CondStack:  condStack,
+		NumOps:     vm.numOps,
+		Available:  available,
+	}
+}
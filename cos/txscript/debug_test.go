@@ -0,0 +1,157 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import "testing"
+
+func TestStepOverStepsPastAChildScript(t *testing.T) {
+	vm := &Engine{}
+	if err := vm.PushScript([]byte{OP_1}); err != nil {
+		t.Fatalf("PushScript: %v", err)
+	}
+	if err := vm.PushScript([]byte{OP_2}); err != nil {
+		t.Fatalf("PushScript(child): %v", err)
+	}
+	if depth := vm.estack.Depth(); depth != 2 {
+		t.Fatalf("estack depth = %d, want 2", depth)
+	}
+
+	done, err := vm.StepOver()
+	if err != nil {
+		t.Fatalf("StepOver: %v", err)
+	}
+	if done {
+		t.Fatal("StepOver reported done, want more to execute in the outer script")
+	}
+	if depth := vm.estack.Depth(); depth != 1 {
+		t.Fatalf("estack depth after StepOver = %d, want back down to 1", depth)
+	}
+}
+
+func TestStepOutReturnsToCaller(t *testing.T) {
+	vm := &Engine{}
+	if err := vm.PushScript([]byte{OP_1, OP_2}); err != nil {
+		t.Fatalf("PushScript: %v", err)
+	}
+	if err := vm.PushScript([]byte{OP_3}); err != nil {
+		t.Fatalf("PushScript(child): %v", err)
+	}
+
+	done, err := vm.StepOut()
+	if err != nil {
+		t.Fatalf("StepOut: %v", err)
+	}
+	if done {
+		t.Fatal("StepOut reported done, want the outer script to still have OP_2 left")
+	}
+	if depth := vm.estack.Depth(); depth != 1 {
+		t.Fatalf("estack depth after StepOut = %d, want back down to 1", depth)
+	}
+}
+
+func TestSetClearBreakpointAndContinue(t *testing.T) {
+	vm := &Engine{}
+	script := []byte{OP_1, OP_2, OP_3}
+	if err := vm.PushScript(script); err != nil {
+		t.Fatalf("PushScript: %v", err)
+	}
+
+	vm.SetBreakpoint(0, 2) // the offset just past OP_2, where the frame sits while positioned on OP_2
+	done, err := vm.Continue()
+	if err != nil {
+		t.Fatalf("Continue: %v", err)
+	}
+	if done {
+		t.Fatal("Continue ran past the breakpoint")
+	}
+	if op := vm.estack.Peek().opcode(); op != OP_2 {
+		t.Fatalf("opcode at the breakpoint = %v, want OP_2", op)
+	}
+
+	vm.ClearBreakpoint(0, 2)
+	done, err = vm.Continue()
+	if err != nil {
+		t.Fatalf("Continue after ClearBreakpoint: %v", err)
+	}
+	if !done {
+		t.Fatal("Continue after ClearBreakpoint didn't run to completion")
+	}
+}
+
+// TestBreakpointDistinguishesSiblingScripts is a regression test for
+// breakpoints/Trace identifying a script by its execution-stack depth rather
+// than its stable vm.scripts index: two scripts pushed one after another at
+// the same depth (e.g. two OP_CHECKPREDICATE calls in a row, each child
+// popped before the next is pushed) used to be indistinguishable, so a
+// breakpoint armed against the first could spuriously fire during the
+// second.
+func TestBreakpointDistinguishesSiblingScripts(t *testing.T) {
+	vm := &Engine{}
+	if err := vm.PushScript([]byte{OP_1}); err != nil { // outer: scriptIdx 0
+		t.Fatalf("PushScript(outer): %v", err)
+	}
+
+	if err := vm.PushScript([]byte{OP_2}); err != nil { // child A: scriptIdx 1
+		t.Fatalf("PushScript(child A): %v", err)
+	}
+	childA := vm.estack.Peek()
+	for !childA.done() {
+		childA.step()
+	}
+	if done, err := vm.estack.nextFrame(); done || err != nil {
+		t.Fatalf("nextFrame() = (%v, %v), want (false, nil)", done, err)
+	}
+	if depth := vm.estack.Depth(); depth != 1 {
+		t.Fatalf("estack depth after child A finishes = %d, want back down to 1", depth)
+	}
+
+	if err := vm.PushScript([]byte{OP_3}); err != nil { // child B: scriptIdx 2, same depth as A
+		t.Fatalf("PushScript(child B): %v", err)
+	}
+	childB := vm.estack.Peek()
+	if childB.scriptIdx == childA.scriptIdx {
+		t.Fatalf("sibling scripts got the same scriptIdx (%d)", childB.scriptIdx)
+	}
+
+	// Armed against child A's position - same depth and offset childB now
+	// occupies - this must not fire while B is executing.
+	vm.SetBreakpoint(childA.scriptIdx, childB.byteIndex())
+	if vm.atBreakpoint() {
+		t.Fatal("atBreakpoint = true for a breakpoint armed against a different, already-finished sibling script")
+	}
+
+	vm.SetBreakpoint(childB.scriptIdx, childB.byteIndex())
+	if !vm.atBreakpoint() {
+		t.Fatal("atBreakpoint = false for a breakpoint armed against the script actually executing")
+	}
+}
+
+func TestTraceSnapshot(t *testing.T) {
+	vm := &Engine{available: []uint64{5, 10}}
+	if err := vm.PushScript([]byte{OP_1, OP_CHECKSIG}); err != nil {
+		t.Fatalf("PushScript: %v", err)
+	}
+
+	snap := vm.Trace()
+	if snap.ScriptIdx != 0 {
+		t.Fatalf("ScriptIdx = %d, want 0", snap.ScriptIdx)
+	}
+	if snap.Offset != 1 {
+		t.Fatalf("Offset = %d, want 1 (just past the first opcode)", snap.Offset)
+	}
+	if want := disasmOpcode(OP_1, nil); snap.NextOpcode != want {
+		t.Fatalf("NextOpcode = %q, want %q", snap.NextOpcode, want)
+	}
+	if len(snap.Available) != 2 || snap.Available[0] != 5 || snap.Available[1] != 10 {
+		t.Fatalf("Available = %v, want [5 10]", snap.Available)
+	}
+
+	// The snapshot's Available must be a copy: mutating it shouldn't affect
+	// the running engine.
+	snap.Available[0] = 999
+	if vm.available[0] != 5 {
+		t.Fatal("Trace's Available slice aliases the engine's, want an independent copy")
+	}
+}
@@ -43,12 +43,14 @@ const (
 	// ScriptVerifyStrictEncoding defines that signature scripts and
 	// public keys must follow the strict encoding requirements.
 	ScriptVerifyStrictEncoding
-)
 
-const (
-	// maxExecutionStackSize is the maximum number of stack frames that
-	// can be on the execution stack.
-	maxExecutionStackSize = 10
+	// ScriptVerifyCodeSepSlice defines that the subscript signed by
+	// OP_CHECKSIG/OP_CHECKMULTISIG after an OP_CODESEPARATOR has executed
+	// is frame.script[lastCodeSep:] verbatim, rather than the whole script
+	// with every OP_CODESEPARATOR byte stripped out of it. This changes
+	// consensus-critical sighash behavior, so it must stay off for
+	// existing chains and only be set for new ones that opt in.
+	ScriptVerifyCodeSepSlice
 )
 
 type (
@@ -56,7 +58,8 @@ type (
 	Engine struct {
 		scriptVersion    []byte
 		scriptVersionVal scriptNum   // optimization - the scriptNum value of scriptVersion
-		estack           scriptStack // execution stack
+		scripts          [][]byte    // raw bytes of every script pushed so far, outermost first
+		estack           scriptStack // execution stack; each frame steps its own tokenizer over scripts[i]
 		dstack           stack       // data stack
 		astack           stack       // alternate data stack
 		tx               *bc.TxData
@@ -66,6 +69,11 @@ type (
 		numOps           int
 		flags            ScriptFlags
 		available        []uint64 // mutable copy of each output's Amount field, used for OP_RESERVEOUTPUT reservations
+
+		breakpoints []breakpoint
+		hooks       []Hook
+
+		sigCache SigCache
 	}
 )
 
@@ -102,54 +110,62 @@ func (vm *Engine) isBranchExecuting() bool {
 // executeOpcode peforms execution on the passed opcode.  It takes into account
 // whether or not it is hidden by conditionals, but some rules still must be
 // tested in this case.
-func (vm *Engine) executeOpcode(pop *parsedOpcode) error {
+//
+// Unlike the old parsedOpcode-based engine, the opcode and its data arrive as
+// a plain (byte, []byte) pair straight from the tokenizer, so stepping a
+// script involves no up-front parse allocation.
+func (vm *Engine) executeOpcode(opcode byte, data []byte) error {
 	// Disabled opcodes are fail on program counter.
-	if pop.isDisabled(int(vm.currentVersion()), vm.block != nil) {
-		return ErrStackOpDisabled
+	if opcodeDisabled(opcode, int(vm.currentVersion()), vm.block != nil) {
+		return scriptError(ErrDisabledOpcode, fmt.Sprintf("attempt to execute disabled opcode %s", opcodeName(opcode)))
 	}
 
 	// Always-illegal opcodes are fail on program counter.
-	if pop.alwaysIllegal() {
-		return ErrStackReservedOpcode
+	if opcodeAlwaysIllegal(opcode) {
+		return scriptError(ErrReservedOpcode, fmt.Sprintf("attempt to execute reserved opcode %s", opcodeName(opcode)))
 	}
 
 	// Note that this includes OP_RESERVED which counts as a push operation.
-	if pop.opcode.value > OP_16 {
+	if opcode > OP_16 {
 		vm.numOps++
 		if vm.numOps > maxOpsPerScript {
 			return ErrStackTooManyOperations
 		}
 
-	} else if len(pop.data) > MaxScriptElementSize {
+	} else if len(data) > MaxScriptElementSize {
 		return ErrStackElementTooBig
 	}
 
 	// Nothing left to do when this is not a conditional opcode and it is
 	// not in an executing branch.
-	if !vm.isBranchExecuting() && !pop.isConditional() {
+	if !vm.isBranchExecuting() && !isConditionalOpcode(opcode) {
 		return nil
 	}
 
-	return pop.opcode.opfunc(pop, vm)
+	return opcodeExecute(opcode, data, vm)
 }
 
 // DisasmPC returns the string for the disassembly of the opcode that will be
 // next to execute when Step() is called.
 func (vm *Engine) DisasmPC() (string, error) {
-	frame, off, err := vm.estack.curPC()
+	_, off, err := vm.estack.curPC()
 	if err != nil {
 		return "", err
 	}
-	return vm.estack.disasm(frame, off), nil
+	return vm.estack.disasm(off), nil
 }
 
-// DisasmScript returns the disassembly string for the entire script.
+// DisasmScript returns the disassembly string for every script pushed since
+// the last Prepare (vm.scripts), most recently pushed first, including ones
+// whose frames have already finished and been popped.  Dumping all of them
+// (rather than only the current frame) gives a full picture of how execution
+// got here when a trace is printed on failure.
 func (vm *Engine) DisasmScript() (string, error) {
 	var disstr string
-	for fIdx := range vm.estack.frames {
-		frame := vm.estack.frames[len(vm.estack.frames)-fIdx-1]
-		for idx := range frame.script {
-			disstr = disstr + frame.disasm(idx) + "\n"
+	for i := len(vm.scripts) - 1; i >= 0; i-- {
+		tok := makeScriptTokenizer(uint16(vm.scriptVersionVal), vm.scripts[i])
+		for tok.Next() {
+			disstr = disstr + disasmOpcode(tok.Opcode(), tok.Data()) + "\n"
 		}
 	}
 	return disstr, nil
@@ -182,10 +198,35 @@ func (vm *Engine) CheckErrorCondition(finalScript bool) error {
 	return nil
 }
 
-// PushScript is called by OP_CHECKPREDICATE. It adds a new stack
-// frame to the top of the execution stack.
-func (vm *Engine) PushScript(newScript []parsedOpcode) {
-	vm.estack.Push(&stackFrame{script: newScript})
+// PushScript is called by OP_CHECKPREDICATE. It adds a new stack frame to
+// the top of the execution stack, stepping the child script directly off its
+// raw bytes rather than a pre-parsed opcode slice.
+func (vm *Engine) PushScript(newScript []byte) error {
+	vm.scripts = append(vm.scripts, newScript)
+	scriptIdx := len(vm.scripts) - 1
+	frame := &stackFrame{tok: makeScriptTokenizer(uint16(vm.scriptVersionVal), newScript), scriptIdx: scriptIdx}
+	if !frame.step() {
+		// An empty script primes to done() with no error; anything else
+		// means the very first opcode failed to tokenize.
+		if err := frame.tok.Err(); err != nil {
+			return withScriptIndex(scriptIdx, err)
+		}
+	}
+	vm.estack.Push(frame)
+	return nil
+}
+
+// withScriptIndex annotates a tokenizer parse error with the index (within
+// vm.scripts) of the script it was raised for. The tokenizer itself only
+// knows about the bytes it's walking, not which script that is among the
+// ones an Engine has pushed, so the call site is what has to add this.
+func withScriptIndex(idx int, err error) error {
+	e, ok := err.(Error)
+	if !ok {
+		return err
+	}
+	e.Description = fmt.Sprintf("script %d: %s", idx, e.Description)
+	return e
 }
 
 // Step will execute the next instruction and move the program counter to the
@@ -197,33 +238,44 @@ func (vm *Engine) PushScript(newScript []parsedOpcode) {
 func (vm *Engine) Step() (done bool, err error) {
 
 	// Verify that it is pointing to a valid address.
-	_, off, err := vm.estack.curPC()
-	if err != nil {
+	if _, _, err := vm.estack.curPC(); err != nil {
 		return true, err
 	}
 	frame := vm.estack.Peek()
-	opcode := frame.opcode(off)
+
+	if err := vm.runHooks(); err != nil {
+		return true, err
+	}
 
 	// Execute the opcode while taking into account several things such as
 	// disabled opcodes, illegal opcodes, maximum allowed operations per
 	// script, maximum script element sizes, and conditionals.
-	err = vm.executeOpcode(opcode)
+	err = vm.executeOpcode(frame.opcode(), frame.data())
 	if err != nil {
 		return true, err
 	}
 
+	if err := vm.runHooks(); err != nil {
+		return true, err
+	}
+
 	// The number of elements in the combination of the data and alt stacks
 	// must not exceed the maximum number of stack elements allowed.
-	if int(vm.dstack.Depth()+vm.astack.Depth()) > maxStackSize {
-		return false, ErrStackOverflow
+	if int(vm.dstack.Depth()+vm.astack.Depth()) > MaxStackSize {
+		return false, ErrStackStackOverflow
 	}
 	// The number of stack frames is also limited.
-	if vm.estack.Depth() > maxExecutionStackSize {
-		return false, ErrStackOverflow
+	if vm.estack.Depth() > MaxExecutionStackSize {
+		return false, ErrStackStackOverflow
 	}
 
-	// Move on to the next instruction.
-	frame.step()
+	// Move on to the next instruction. The tokenizer decodes it eagerly so
+	// DisasmPC can describe it without re-walking the script.
+	if !frame.step() {
+		if err := frame.tok.Err(); err != nil {
+			return true, withScriptIndex(frame.scriptIdx, err)
+		}
+	}
 
 	// If we're finished with the frame, pop off stack frames until we find
 	// one that is not finished yet.
@@ -287,11 +339,39 @@ func (vm *Engine) checkHashTypeEncoding(hashType bc.SigHashType) error {
 
 	sigHashType := hashType & ^bc.SigHashAnyOneCanPay
 	if sigHashType < bc.SigHashAll || sigHashType > bc.SigHashSingle {
-		return fmt.Errorf("invalid hashtype: 0x%x\n", hashType)
+		return scriptError(ErrBadHashType, fmt.Sprintf("ScriptVerifyStrictEncoding: invalid hashtype 0x%x", hashType))
 	}
 	return nil
 }
 
+// opcodeCodeSeparator is the OP_CODESEPARATOR handler. It records the byte
+// offset just after the separator on the current frame so that subScript
+// can find it at sighash time; it does not itself alter the script being
+// stepped through.
+//
+// The offset is taken after frame.step() has already moved the tokenizer
+// past OP_CODESEPARATOR (i.e. frame.byteIndex() is post-step), so that the
+// subscript begins immediately after the separator rather than on it.
+func opcodeCodeSeparator(opcode byte, data []byte, vm *Engine) error {
+	frame := vm.estack.Peek()
+	frame.lastCodeSep = frame.byteIndex()
+	return nil
+}
+
+// subScript returns the portion of the current frame's script that
+// OP_CHECKSIG/OP_CHECKMULTISIG should sign. Under ScriptVerifyCodeSepSlice it
+// is frame.script[lastCodeSep:] verbatim, including any OP_CODESEPARATOR
+// bytes that occur after the split point. Without the flag, subscripting
+// falls back to the legacy behavior of stripping every OP_CODESEPARATOR byte
+// out of the whole script, for consensus compatibility with existing chains.
+func (vm *Engine) subScript() []byte {
+	frame := vm.estack.Peek()
+	if vm.hasFlag(ScriptVerifyCodeSepSlice) {
+		return frame.script()[frame.lastCodeSep:]
+	}
+	return removeOpcode(frame.script(), OP_CODESEPARATOR)
+}
+
 // getStack returns the contents of stack as a byte array bottom up
 func getStack(stack *stack) [][]byte {
 	array := make([][]byte, stack.Depth())
@@ -343,7 +423,7 @@ func (vm *Engine) SetAltStack(data [][]byte) {
 func (vm *Engine) Prepare(script []byte, args [][]byte, txIdx int) error {
 	// The provided transaction input index must refer to a valid input.
 	if txIdx < 0 || (vm.tx != nil && txIdx >= len(vm.tx.Inputs)) {
-		return ErrInvalidIndex
+		return ErrStackInvalidIndex
 	}
 	vm.txIdx = txIdx
 
@@ -357,15 +437,14 @@ func (vm *Engine) Prepare(script []byte, args [][]byte, txIdx int) error {
 	if len(script) > bc.MaxProgramByteLength {
 		return ErrStackLongScript
 	}
-	parsedScript, err := parseScript(script)
-	if err != nil {
-		return err
-	}
 
-	vm.scriptVersion = parseScriptVersion(parsedScript)
+	vm.scriptVersion = parseScriptVersion(script)
 	vm.scriptVersionVal, _ = makeScriptNum(vm.scriptVersion, false) // swallow errors
 
-	vm.PushScript(parsedScript)
+	vm.scripts = vm.scripts[:0]
+	if err := vm.PushScript(script); err != nil {
+		return err
+	}
 
 	vm.numOps = 0
 
@@ -382,11 +461,11 @@ func (vm *Engine) Prepare(script []byte, args [][]byte, txIdx int) error {
 //   }
 // Note: every call to Execute() must be preceded by a call to
 // Prepare() (including the first one).
-func NewReusableEngine(tx *bc.TxData, flags ScriptFlags) (*Engine, error) {
-	return newReusableEngine(tx, nil, flags)
+func NewReusableEngine(tx *bc.TxData, flags ScriptFlags, opts ...EngineOption) (*Engine, error) {
+	return newReusableEngine(tx, nil, flags, opts...)
 }
 
-func newReusableEngine(tx *bc.TxData, block *bc.Block, flags ScriptFlags) (*Engine, error) {
+func newReusableEngine(tx *bc.TxData, block *bc.Block, flags ScriptFlags, opts ...EngineOption) (*Engine, error) {
 	vm := &Engine{
 		tx:    tx,
 		block: block,
@@ -403,6 +482,10 @@ func newReusableEngine(tx *bc.TxData, block *bc.Block, flags ScriptFlags) (*Engi
 		}
 	}
 
+	for _, opt := range opts {
+		opt(vm)
+	}
+
 	return vm, nil
 }
 
@@ -412,8 +495,8 @@ func newReusableEngine(tx *bc.TxData, block *bc.Block, flags ScriptFlags) (*Engi
 //
 // This is equivalent to calling NewReusableEngine() followed by a
 // call to Prepare().
-func NewEngine(scriptPubKey []byte, tx *bc.TxData, txIdx int, flags ScriptFlags) (*Engine, error) {
-	vm, err := NewReusableEngine(tx, flags)
+func NewEngine(scriptPubKey []byte, tx *bc.TxData, txIdx int, flags ScriptFlags, opts ...EngineOption) (*Engine, error) {
+	vm, err := NewReusableEngine(tx, flags, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -425,8 +508,8 @@ func NewEngine(scriptPubKey []byte, tx *bc.TxData, txIdx int, flags ScriptFlags)
 // NewEngineForBlock returns a new script engine for the provided block
 // and its script. The flags modify the behavior of the script engine
 // according to the description provided by each flag.
-func NewEngineForBlock(scriptPubKey []byte, block *bc.Block, flags ScriptFlags) (*Engine, error) {
-	vm, err := newReusableEngine(nil, block, flags)
+func NewEngineForBlock(scriptPubKey []byte, block *bc.Block, flags ScriptFlags, opts ...EngineOption) (*Engine, error) {
+	vm, err := newReusableEngine(nil, block, flags, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,38 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestPushScriptErrorHasScriptIndex checks that a tokenize failure raised
+// while pushing a script is annotated with that script's index, so a caller
+// juggling several scripts (e.g. via OP_CHECKPREDICATE) can tell which one
+// failed instead of just getting a bare byte offset.
+func TestPushScriptErrorHasScriptIndex(t *testing.T) {
+	vm := &Engine{}
+
+	// Script 0 is well-formed; script 1 claims more data than it has.
+	if err := vm.PushScript([]byte{OP_1}); err != nil {
+		t.Fatalf("PushScript(script 0): %v", err)
+	}
+	err := vm.PushScript([]byte{0x02, 0xAB})
+	if err == nil {
+		t.Fatal("PushScript(script 1) = nil, want a short-script error")
+	}
+
+	e, ok := err.(Error)
+	if !ok {
+		t.Fatalf("PushScript error = %v (%T), want a txscript.Error", err, err)
+	}
+	if e.ErrorCode != ErrShortScript {
+		t.Fatalf("ErrorCode = %v, want ErrShortScript", e.ErrorCode)
+	}
+	if !strings.Contains(e.Description, "script 1") {
+		t.Fatalf("Description = %q, want it to mention script index 1", e.Description)
+	}
+}
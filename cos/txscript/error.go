@@ -0,0 +1,178 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import "fmt"
+
+// These constants are the public limits consumers of the package may want to
+// reason about. They used to live as unexported values next to the stack and
+// script parsing code; exporting them lets callers size buffers or validate
+// scripts without duplicating the engine's own rules.
+const (
+	// MaxStackSize is the maximum combined height of the data and alt
+	// stacks during execution.
+	MaxStackSize = 1000
+
+	// MaxScriptElementSize is the maximum allowed length of a data push.
+	MaxScriptElementSize = 520
+
+	// MaxExecutionStackSize is the maximum number of stack frames that can
+	// be on the execution stack at once.
+	MaxExecutionStackSize = 10
+
+	// MaxPubKeysPerMultiSig is the maximum number of public keys (and thus
+	// the maximum number of signatures) OP_CHECKMULTISIG(VERIFY) accepts.
+	MaxPubKeysPerMultiSig = 20
+)
+
+// ErrorCode identifies a kind of script error.
+type ErrorCode int
+
+const (
+	// ErrDisabledOpcode indicates the script included an opcode that has
+	// been disabled.
+	ErrDisabledOpcode ErrorCode = iota
+
+	// ErrReservedOpcode indicates the script included an opcode that is
+	// always illegal, regardless of whether it appears in an executing
+	// or non-executing branch.
+	ErrReservedOpcode
+
+	// ErrTooManyOperations indicates the script has exceeded the maximum
+	// allowed number of operations.
+	ErrTooManyOperations
+
+	// ErrElementTooBig indicates an element pushed onto the stack exceeds
+	// MaxScriptElementSize.
+	ErrElementTooBig
+
+	// ErrScriptUnfinished indicates an action was requested, such as
+	// checking the error condition, before all scripts in the engine have
+	// finished executing.
+	ErrScriptUnfinished
+
+	// ErrEmptyStack indicates the data stack was empty when CheckErrorCondition
+	// tried to pop the final boolean.
+	ErrEmptyStack
+
+	// ErrScriptFailed indicates the final value on the data stack was
+	// false, so the script evaluated to an invalid transaction.
+	ErrScriptFailed
+
+	// ErrStackOverflow indicates either the combined data/alt stacks or
+	// the execution stack grew past their maximum allowed sizes.
+	ErrStackOverflow
+
+	// ErrScriptTooBig indicates the script exceeds bc.MaxProgramByteLength.
+	ErrScriptTooBig
+
+	// ErrInvalidIndex indicates an out-of-range transaction input index
+	// was passed to Prepare.
+	ErrInvalidIndex
+
+	// ErrShortScript indicates a script element or opcode claims more
+	// data than remains in the script during parsing or tokenizing.
+	ErrShortScript
+
+	// ErrBadHashType indicates a signature hash type fails the strict
+	// encoding check requested by ScriptVerifyStrictEncoding.
+	ErrBadHashType
+
+	// ErrInvalidSignature indicates a signature, or an argument standing
+	// in for one, failed a structural check such as ScriptStrictMultiSig's
+	// requirement that OP_CHECKMULTISIG's extra argument be zero length.
+	ErrInvalidSignature
+
+	// ErrInvalidSigCount indicates OP_CHECKMULTISIG's encoded pubkey or
+	// signature count is negative or exceeds MaxPubKeysPerMultiSig.
+	ErrInvalidSigCount
+)
+
+// errorCodeStrings is a descriptive name for each ErrorCode, used by the
+// default Error.Error() string.
+var errorCodeStrings = map[ErrorCode]string{
+	ErrDisabledOpcode:    "ErrDisabledOpcode",
+	ErrReservedOpcode:    "ErrReservedOpcode",
+	ErrTooManyOperations: "ErrTooManyOperations",
+	ErrElementTooBig:     "ErrElementTooBig",
+	ErrScriptUnfinished:  "ErrScriptUnfinished",
+	ErrEmptyStack:        "ErrEmptyStack",
+	ErrScriptFailed:      "ErrScriptFailed",
+	ErrStackOverflow:     "ErrStackOverflow",
+	ErrScriptTooBig:      "ErrScriptTooBig",
+	ErrInvalidIndex:      "ErrInvalidIndex",
+	ErrShortScript:       "ErrShortScript",
+	ErrBadHashType:       "ErrBadHashType",
+	ErrInvalidSignature:  "ErrInvalidSignature",
+	ErrInvalidSigCount:   "ErrInvalidSigCount",
+}
+
+// String returns the ErrorCode's constant name.
+func (e ErrorCode) String() string {
+	if s, ok := errorCodeStrings[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown ErrorCode (%d)", int(e))
+}
+
+// Error identifies a script-validation error, along with a human-readable
+// description that carries whatever context was available when it was
+// raised (the opcode name, the script index and offset, the flag that
+// failed, and so on). Because that description varies from one occurrence
+// of a given ErrorCode to the next, two Errors with the same code are not
+// necessarily == to each other; compare with errors.Is, or type-assert and
+// compare ErrorCode directly:
+//
+//	if e, ok := err.(txscript.Error); ok && e.ErrorCode == txscript.ErrDisabledOpcode {
+//		...
+//	}
+//
+//	if errors.Is(err, txscript.ErrStackOpDisabled) {
+//		...
+//	}
+type Error struct {
+	ErrorCode   ErrorCode
+	Description string
+}
+
+// Error satisfies the error interface.
+func (e Error) Error() string {
+	return e.Description
+}
+
+// Is reports whether target is an Error with the same ErrorCode, ignoring
+// Description, so errors.Is(err, txscript.ErrStackOpDisabled) still matches
+// a contextual error constructed with a different message for the same
+// ErrorCode.
+func (e Error) Is(target error) bool {
+	te, ok := target.(Error)
+	if !ok {
+		return false
+	}
+	return e.ErrorCode == te.ErrorCode
+}
+
+// scriptError creates an Error given a set of arguments.
+func scriptError(c ErrorCode, desc string) Error {
+	return Error{ErrorCode: c, Description: desc}
+}
+
+// Deprecated: these package-level variables are kept so existing callers
+// that compare errors with errors.Is keep working. New code should compare
+// ErrorCode via a txscript.Error type assertion instead. Plain == no longer
+// suffices now that Description carries call-site-specific context.
+var (
+	ErrStackOpDisabled        = scriptError(ErrDisabledOpcode, "attempt to execute disabled opcode")
+	ErrStackReservedOpcode    = scriptError(ErrReservedOpcode, "attempt to execute reserved opcode")
+	ErrStackTooManyOperations = scriptError(ErrTooManyOperations, "exceeded max operation limit in script")
+	ErrStackElementTooBig     = scriptError(ErrElementTooBig, "element size exceeds max allowed size")
+	ErrStackScriptUnfinished  = scriptError(ErrScriptUnfinished, "error check when script unfinished")
+	ErrStackEmptyStack        = scriptError(ErrEmptyStack, "stack empty at end of script execution")
+	ErrStackScriptFailed      = scriptError(ErrScriptFailed, "script did not validate")
+	ErrStackStackOverflow     = scriptError(ErrStackOverflow, "stack size exceeds max allowed size")
+	ErrStackLongScript        = scriptError(ErrScriptTooBig, "script is longer than the maximum allowed length")
+	ErrStackInvalidIndex      = scriptError(ErrInvalidIndex, "input index is invalid")
+	ErrStackShortScript       = scriptError(ErrShortScript, "script claims more data than is available")
+)
@@ -0,0 +1,164 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import "chain/cos/bc"
+
+// opcodeCheckSig is the OP_CHECKSIG handler. It pops a pubkey and a
+// signature off the data stack, verifies the signature against the
+// subscript for the current input, and pushes the boolean result.
+//
+// Verification itself is routed through vm.checkSig so a shared SigCache
+// can short-circuit a signature that has already been checked once, e.g.
+// during mempool acceptance, rather than redoing the curve math when the
+// same transaction is re-verified at block-connect time.
+func opcodeCheckSig(opcode byte, data []byte, vm *Engine) error {
+	pubKey, err := vm.dstack.PopByteArray()
+	if err != nil {
+		return err
+	}
+	fullSig, err := vm.dstack.PopByteArray()
+	if err != nil {
+		return err
+	}
+
+	if len(fullSig) == 0 {
+		vm.dstack.PushBool(false)
+		return nil
+	}
+
+	hashType := bc.SigHashType(fullSig[len(fullSig)-1])
+	sig := fullSig[:len(fullSig)-1]
+
+	if err := vm.checkHashTypeEncoding(hashType); err != nil {
+		return err
+	}
+	if err := checkSignatureEncoding(sig, vm.flags); err != nil {
+		return err
+	}
+	if err := checkPubKeyEncoding(pubKey, vm.flags); err != nil {
+		return err
+	}
+
+	sigHash := vm.sigHasher.Hash(vm.txIdx, hashType, vm.subScript())
+	valid := vm.checkSig(sigHash, sig, pubKey, func() bool {
+		return verifySignature(pubKey, sig, sigHash)
+	})
+
+	vm.dstack.PushBool(valid)
+	return nil
+}
+
+// opcodeCheckMultiSig is the OP_CHECKMULTISIG handler. It pops n pubkeys, m
+// signatures, and the extra (BIP0147-style) stack element off the data
+// stack, then checks each signature in order against the remaining pubkeys,
+// consuming a pubkey for every signature that verifies. Like
+// opcodeCheckSig, every individual signature check goes through
+// vm.checkSig so a shared SigCache can skip already-verified pairs.
+func opcodeCheckMultiSig(opcode byte, data []byte, vm *Engine) error {
+	n, err := vm.dstack.PopInt()
+	if err != nil {
+		return err
+	}
+	if err := checkMultiSigPubKeyCount(n); err != nil {
+		return err
+	}
+	pubKeys := make([][]byte, n)
+	for i := range pubKeys {
+		pubKeys[len(pubKeys)-i-1], err = vm.dstack.PopByteArray()
+		if err != nil {
+			return err
+		}
+	}
+
+	m, err := vm.dstack.PopInt()
+	if err != nil {
+		return err
+	}
+	if err := checkMultiSigSigCount(m, n); err != nil {
+		return err
+	}
+	sigs := make([][]byte, m)
+	for i := range sigs {
+		sigs[len(sigs)-i-1], err = vm.dstack.PopByteArray()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Historical off-by-one bug in the reference implementation: an extra
+	// value is popped and, when ScriptStrictMultiSig is set, must be empty.
+	extra, err := vm.dstack.PopByteArray()
+	if err != nil {
+		return err
+	}
+	if vm.hasFlag(ScriptStrictMultiSig) && len(extra) != 0 {
+		return scriptError(ErrInvalidSignature, "extra OP_CHECKMULTISIG argument is not zero length")
+	}
+
+	subScript := vm.subScript()
+	success := matchMultiSig(sigs, pubKeys, func(sig, pubKey []byte) bool {
+		hashType := bc.SigHashType(sig[len(sig)-1])
+		rawSig := sig[:len(sig)-1]
+		sigHash := vm.sigHasher.Hash(vm.txIdx, hashType, subScript)
+		return vm.checkSig(sigHash, rawSig, pubKey, func() bool {
+			return verifySignature(pubKey, rawSig, sigHash)
+		})
+	})
+
+	vm.dstack.PushBool(success)
+	return nil
+}
+
+// checkMultiSigPubKeyCount validates OP_CHECKMULTISIG's n (pubkey count)
+// before it reaches make([][]byte, n): n comes straight off the data stack,
+// so without this check a negative count panics make() and a huge positive
+// one is an easy way to force a huge allocation per opcode.
+func checkMultiSigPubKeyCount(n int) error {
+	if n < 0 || n > MaxPubKeysPerMultiSig {
+		return scriptError(ErrInvalidSigCount, "OP_CHECKMULTISIG pubkey count out of range")
+	}
+	return nil
+}
+
+// checkMultiSigSigCount validates OP_CHECKMULTISIG's m (signature count)
+// the same way checkMultiSigPubKeyCount validates n, with the additional
+// consensus rule that there can never be more signatures than pubkeys.
+func checkMultiSigSigCount(m, n int) error {
+	if m < 0 || m > n {
+		return scriptError(ErrInvalidSigCount, "OP_CHECKMULTISIG signature count out of range")
+	}
+	return nil
+}
+
+// matchMultiSig implements OP_CHECKMULTISIG's matching rule, split out of
+// opcodeCheckMultiSig so it can be exercised without an Engine: sigs and
+// pubKeys are each walked in order, and a signature may skip over pubkeys
+// that don't match it but can never match one out of order or more than
+// once. verify is only called for non-empty signatures.
+//
+// A signature that verify rejects - including an empty one, which is never
+// even passed to verify - just costs the pubkey it was tried against and
+// moves on; sigIdx only advances past a signature once something actually
+// matched it. That's what stops a run of empty "signatures" from silently
+// satisfying the threshold on a single real signature's behalf.
+func matchMultiSig(sigs, pubKeys [][]byte, verify func(sig, pubKey []byte) bool) bool {
+	pubKeyIdx, sigIdx := 0, 0
+	for sigIdx < len(sigs) {
+		// Not enough pubkeys left to satisfy the remaining signatures.
+		if len(sigs)-sigIdx > len(pubKeys)-pubKeyIdx {
+			break
+		}
+
+		sig := sigs[sigIdx]
+		pubKey := pubKeys[pubKeyIdx]
+		pubKeyIdx++
+
+		if len(sig) != 0 && verify(sig, pubKey) {
+			sigIdx++
+		}
+	}
+	return sigIdx == len(sigs)
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"errors"
+	"testing"
+)
+
+// byPubKey returns a verify func for matchMultiSig that treats sig as valid
+// only against the pubkey it names, so tests can describe which (sig,
+// pubkey) pairs are "real" without any actual signing or an Engine.
+func byPubKey(valid map[string]string) func(sig, pubKey []byte) bool {
+	return func(sig, pubKey []byte) bool {
+		return valid[string(sig)] == string(pubKey)
+	}
+}
+
+func TestCheckMultiSigPubKeyCount(t *testing.T) {
+	cases := []struct {
+		n       int
+		wantErr bool
+	}{
+		{n: -1, wantErr: true},
+		{n: 0, wantErr: false},
+		{n: MaxPubKeysPerMultiSig, wantErr: false},
+		{n: MaxPubKeysPerMultiSig + 1, wantErr: true},
+	}
+	for _, c := range cases {
+		err := checkMultiSigPubKeyCount(c.n)
+		if c.wantErr && !errors.Is(err, Error{ErrorCode: ErrInvalidSigCount}) {
+			t.Errorf("checkMultiSigPubKeyCount(%d) = %v, want ErrInvalidSigCount", c.n, err)
+		}
+		if !c.wantErr && err != nil {
+			t.Errorf("checkMultiSigPubKeyCount(%d) = %v, want nil", c.n, err)
+		}
+	}
+}
+
+func TestCheckMultiSigSigCount(t *testing.T) {
+	cases := []struct {
+		m, n    int
+		wantErr bool
+	}{
+		{m: -1, n: 3, wantErr: true},
+		{m: 0, n: 3, wantErr: false},
+		{m: 3, n: 3, wantErr: false},
+		{m: 4, n: 3, wantErr: true},
+	}
+	for _, c := range cases {
+		err := checkMultiSigSigCount(c.m, c.n)
+		if c.wantErr && !errors.Is(err, Error{ErrorCode: ErrInvalidSigCount}) {
+			t.Errorf("checkMultiSigSigCount(%d, %d) = %v, want ErrInvalidSigCount", c.m, c.n, err)
+		}
+		if !c.wantErr && err != nil {
+			t.Errorf("checkMultiSigSigCount(%d, %d) = %v, want nil", c.m, c.n, err)
+		}
+	}
+}
+
+func TestMatchMultiSig(t *testing.T) {
+	pkA, pkB, pkC := []byte("pkA"), []byte("pkB"), []byte("pkC")
+
+	// A 2-of-3 satisfied by two real signatures in pubkey order.
+	verify := byPubKey(map[string]string{"sigA": "pkA", "sigB": "pkB"})
+	if !matchMultiSig([][]byte{[]byte("sigA"), []byte("sigB")}, [][]byte{pkA, pkB, pkC}, verify) {
+		t.Fatal("matchMultiSig = false for two valid signatures in order, want true")
+	}
+
+	// The same 2-of-3, but the first signature only matches pkB: it must
+	// skip pkA rather than fail outright, since a signature need not match
+	// the very next pubkey.
+	verify = byPubKey(map[string]string{"sigB": "pkB", "sigC": "pkC"})
+	if !matchMultiSig([][]byte{[]byte("sigB"), []byte("sigC")}, [][]byte{pkA, pkB, pkC}, verify) {
+		t.Fatal("matchMultiSig = false when the first signature must skip a pubkey, want true")
+	}
+
+	// A single real signature plus an empty placeholder must NOT satisfy a
+	// 2-of-3: this is the regression case for the bug where an empty
+	// signature was skipped for free instead of costing a pubkey.
+	verify = byPubKey(map[string]string{"sigA": "pkA"})
+	if matchMultiSig([][]byte{{}, []byte("sigA")}, [][]byte{pkA, pkB, pkC}, verify) {
+		t.Fatal("matchMultiSig = true for one empty signature plus one real signature against a 2-of-3, want false")
+	}
+
+	// A signature that doesn't verify against any remaining pubkey fails
+	// the whole check, even if a later signature would have matched.
+	verify = byPubKey(map[string]string{"sigB": "pkB"})
+	if matchMultiSig([][]byte{[]byte("bogus"), []byte("sigB")}, [][]byte{pkA, pkB, pkC}, verify) {
+		t.Fatal("matchMultiSig = true with an unmatched leading signature, want false")
+	}
+
+	// More signatures than pubkeys can ever satisfy always fails, without
+	// calling verify at all.
+	verify = func(sig, pubKey []byte) bool {
+		t.Fatal("verify called when there are more signatures than pubkeys")
+		return true
+	}
+	if matchMultiSig([][]byte{[]byte("s1"), []byte("s2")}, [][]byte{pkA}, verify) {
+		t.Fatal("matchMultiSig = true with more signatures than pubkeys, want false")
+	}
+}
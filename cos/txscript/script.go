@@ -0,0 +1,184 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+// ExtractMultisigScriptDetails parses a script as an m-of-n multisig
+// template directly off the raw bytes, without building a []parsedOpcode.
+// It returns valid=false if the script doesn't match the template. When
+// extractPubKeys is false, pubKeys is always nil, which lets a caller that
+// only wants m and n (e.g. GetSigOpCount) skip the allocation of the decoded
+// key slice.
+func ExtractMultisigScriptDetails(version uint16, script []byte, extractPubKeys bool) (valid bool, m, n int, pubKeys [][]byte) {
+	tok := makeScriptTokenizer(version, script)
+
+	if !tok.Next() || !isSmallInt(tok.Opcode()) {
+		return false, 0, 0, nil
+	}
+	m = asSmallInt(tok.Opcode())
+
+	var keys [][]byte
+	for tok.Next() && isStrictPubKeyPush(tok.Opcode(), tok.Data()) {
+		if extractPubKeys {
+			keys = append(keys, tok.Data())
+		}
+		n++
+	}
+	if n < 1 || n > 20 {
+		return false, 0, 0, nil
+	}
+
+	// The opcode that ended the pubkey loop above must be the count of
+	// pubkeys just collected, followed by OP_CHECKMULTISIG and nothing
+	// else.
+	if !isSmallInt(tok.Opcode()) || asSmallInt(tok.Opcode()) != n {
+		return false, 0, 0, nil
+	}
+	if !tok.Next() || tok.Opcode() != OP_CHECKMULTISIG || !tok.Done() {
+		return false, 0, 0, nil
+	}
+	if err := tok.Err(); err != nil {
+		return false, 0, 0, nil
+	}
+
+	return true, m, n, keys
+}
+
+// IsMultisigScript returns whether script is a standard m-of-n multisig
+// script. It is ExtractMultisigScriptDetails without the pubkey allocation.
+func IsMultisigScript(version uint16, script []byte) bool {
+	valid, _, _, _ := ExtractMultisigScriptDetails(version, script, false)
+	return valid
+}
+
+// IsPushOnly reports whether script contains only data push opcodes,
+// walking the raw bytes with a tokenizer rather than parsing the whole
+// script up front.
+func IsPushOnly(version uint16, script []byte) bool {
+	tok := makeScriptTokenizer(version, script)
+	for tok.Next() {
+		if tok.Opcode() > OP_16 {
+			return false
+		}
+	}
+	return tok.Err() == nil
+}
+
+// IsPayToContract reports whether script is a pay-to-contract (P2C) output
+// script: one that begins by pushing a contract hash and ends in
+// OP_CHECKPREDICATE.
+func IsPayToContract(version uint16, script []byte) bool {
+	return extractContractHash(version, script) != nil
+}
+
+// extractContractHash returns the contract hash committed to by a P2C
+// script, or nil if script isn't a P2C script.
+func extractContractHash(version uint16, script []byte) []byte {
+	tok := makeScriptTokenizer(version, script)
+	if !tok.Next() || len(tok.Data()) == 0 {
+		return nil
+	}
+	hash := tok.Data()
+
+	// There must be at least one more opcode, and the last opcode in the
+	// script must be OP_CHECKPREDICATE, for this to be a P2C script.
+	var lastOpcode byte
+	sawMore := false
+	for tok.Next() {
+		sawMore = true
+		lastOpcode = tok.Opcode()
+	}
+	if tok.Err() != nil || !sawMore || lastOpcode != OP_CHECKPREDICATE {
+		return nil
+	}
+	return hash
+}
+
+// IsPayToMultisig reports whether script is a bare multisig output script.
+func IsPayToMultisig(version uint16, script []byte) bool {
+	return IsMultisigScript(version, script)
+}
+
+// ExtractPkScriptAddrs extracts the pkscript's addressing information
+// without allocating a parse tree: m-of-n multisig details, when script is
+// a multisig script, otherwise nil.
+func ExtractPkScriptAddrs(version uint16, script []byte) (m, n int, pubKeys [][]byte) {
+	valid, m, n, pubKeys := ExtractMultisigScriptDetails(version, script, true)
+	if !valid {
+		return 0, 0, nil
+	}
+	return m, n, pubKeys
+}
+
+// GetSigOpCount returns the number of signature operations in script,
+// treating any possible OP_CHECKMULTISIG(VERIFY) as start requiring 20
+// signature operations (the maximum allowed), since without an executing
+// engine there's no way to know how many were actually pushed.
+func GetSigOpCount(version uint16, script []byte) int {
+	return countSigOps(version, script, false)
+}
+
+// GetPreciseSigOpCount returns the number of signature operations in script,
+// using sigScript (which must be push-only) to determine the exact count
+// for any OP_CHECKMULTISIG(VERIFY) in script, rather than the worst-case 20.
+//
+// script alone is enough to get a precise count when it carries its own
+// small-int pubkey-count push ahead of OP_CHECKMULTISIG(VERIFY), which
+// countSigOps already handles. The case that actually needs sigScript is a
+// pay-to-contract output: script only commits to a hash of the program
+// OP_CHECKPREDICATE will run, so the real sigop count is hiding in whatever
+// program sigScript supplies at spend time, as sigScript's final pushed
+// element.
+func GetPreciseSigOpCount(version uint16, script, sigScript []byte) int {
+	if !IsPayToContract(version, script) {
+		return countSigOps(version, script, true)
+	}
+
+	if !IsPushOnly(version, sigScript) {
+		return GetSigOpCount(version, script)
+	}
+	pushes, err := PushedData(sigScript)
+	if err != nil || len(pushes) == 0 {
+		return GetSigOpCount(version, script)
+	}
+	return countSigOps(version, pushes[len(pushes)-1], true)
+}
+
+// countSigOps is the shared implementation behind GetSigOpCount and
+// GetPreciseSigOpCount.
+func countSigOps(version uint16, script []byte, precise bool) int {
+	tok := makeScriptTokenizer(version, script)
+	var lastOpcode byte
+	var numSigOps int
+	for tok.Next() {
+		switch tok.Opcode() {
+		case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+			numSigOps++
+		case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+			if precise && isSmallInt(lastOpcode) {
+				numSigOps += asSmallInt(lastOpcode)
+			} else {
+				numSigOps += 20
+			}
+		}
+		lastOpcode = tok.Opcode()
+	}
+	return numSigOps
+}
+
+// isStrictPubKeyPush reports whether opcode/data is a direct push of a
+// compressed or uncompressed secp256k1 public key, as required by the
+// multisig template.
+func isStrictPubKeyPush(opcode byte, data []byte) bool {
+	if opcode > OP_PUSHDATA4 {
+		return false
+	}
+	switch len(data) {
+	case 33:
+		return data[0] == 0x02 || data[0] == 0x03
+	case 65:
+		return data[0] == 0x04
+	}
+	return false
+}
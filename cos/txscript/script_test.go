@@ -0,0 +1,167 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"testing"
+)
+
+func multisigScript(m int, pubKeys [][]byte, n int) []byte {
+	var script []byte
+	script = append(script, smallIntOpcode(m))
+	for _, pk := range pubKeys {
+		script = append(script, byte(len(pk)))
+		script = append(script, pk...)
+	}
+	script = append(script, smallIntOpcode(n))
+	script = append(script, OP_CHECKMULTISIG)
+	return script
+}
+
+func smallIntOpcode(n int) byte {
+	return OP_1 + byte(n-1)
+}
+
+func testPubKey(prefix byte) []byte {
+	pk := make([]byte, 33)
+	pk[0] = prefix
+	return pk
+}
+
+func TestExtractMultisigScriptDetails(t *testing.T) {
+	pubKeys := [][]byte{testPubKey(0x02), testPubKey(0x03), testPubKey(0x02)}
+	script := multisigScript(2, pubKeys, 3)
+
+	valid, m, n, keys := ExtractMultisigScriptDetails(1, script, true)
+	if !valid || m != 2 || n != 3 {
+		t.Fatalf("ExtractMultisigScriptDetails = (%v, %d, %d), want (true, 2, 3)", valid, m, n)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("got %d pubkeys, want 3", len(keys))
+	}
+
+	valid, _, _, keys = ExtractMultisigScriptDetails(1, script, false)
+	if !valid {
+		t.Fatal("ExtractMultisigScriptDetails with extractPubKeys=false reported invalid")
+	}
+	if keys != nil {
+		t.Fatalf("expected nil pubKeys when extractPubKeys is false, got %v", keys)
+	}
+
+	if valid, _, _, _ := ExtractMultisigScriptDetails(1, []byte{OP_1, OP_CHECKSIG}, false); valid {
+		t.Fatal("non-multisig script reported as valid multisig")
+	}
+}
+
+func TestIsMultisigScript(t *testing.T) {
+	script := multisigScript(1, [][]byte{testPubKey(0x02)}, 1)
+	if !IsMultisigScript(1, script) {
+		t.Fatal("IsMultisigScript = false, want true")
+	}
+	if IsMultisigScript(1, []byte{OP_1, OP_CHECKSIG}) {
+		t.Fatal("IsMultisigScript = true for a non-multisig script")
+	}
+}
+
+func TestIsPayToMultisig(t *testing.T) {
+	script := multisigScript(1, [][]byte{testPubKey(0x02)}, 1)
+	if !IsPayToMultisig(1, script) {
+		t.Fatal("IsPayToMultisig = false, want true")
+	}
+}
+
+func TestExtractPkScriptAddrs(t *testing.T) {
+	pubKeys := [][]byte{testPubKey(0x02), testPubKey(0x03)}
+	script := multisigScript(1, pubKeys, 2)
+
+	m, n, keys := ExtractPkScriptAddrs(1, script)
+	if m != 1 || n != 2 || len(keys) != 2 {
+		t.Fatalf("ExtractPkScriptAddrs = (%d, %d, %d keys), want (1, 2, 2 keys)", m, n, len(keys))
+	}
+
+	if m, n, keys := ExtractPkScriptAddrs(1, []byte{OP_1, OP_CHECKSIG}); m != 0 || n != 0 || keys != nil {
+		t.Fatalf("ExtractPkScriptAddrs on a non-multisig script = (%d, %d, %v), want (0, 0, nil)", m, n, keys)
+	}
+}
+
+func TestIsPushOnly(t *testing.T) {
+	if !IsPushOnly(1, []byte{0x01, 0xAB}) {
+		t.Fatal("IsPushOnly = false for a pure data push")
+	}
+	if IsPushOnly(1, []byte{0x01, 0xAB, OP_CHECKSIG}) {
+		t.Fatal("IsPushOnly = true for a script containing OP_CHECKSIG")
+	}
+}
+
+// TestIsPayToContract is a regression test for a bug where a script
+// consisting of nothing but a single hash push (no OP_CHECKPREDICATE at all)
+// was misclassified as a valid P2C script, because the terminal-opcode check
+// lived inside the tokenizer loop that a one-opcode script never enters.
+func TestIsPayToContract(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xAB}, 32)
+
+	p2c := append([]byte{byte(len(hash))}, hash...)
+	p2c = append(p2c, OP_CHECKPREDICATE)
+	if !IsPayToContract(1, p2c) {
+		t.Fatal("IsPayToContract = false for a well-formed P2C script")
+	}
+
+	hashOnly := append([]byte{byte(len(hash))}, hash...)
+	if IsPayToContract(1, hashOnly) {
+		t.Fatal("IsPayToContract = true for a script with no OP_CHECKPREDICATE at all")
+	}
+
+	wrongTerminal := append([]byte{byte(len(hash))}, hash...)
+	wrongTerminal = append(wrongTerminal, OP_CHECKSIG)
+	if IsPayToContract(1, wrongTerminal) {
+		t.Fatal("IsPayToContract = true for a script not ending in OP_CHECKPREDICATE")
+	}
+}
+
+func TestGetSigOpCount(t *testing.T) {
+	script := []byte{OP_CHECKSIG, OP_CHECKSIG}
+	if got := GetSigOpCount(1, script); got != 2 {
+		t.Fatalf("GetSigOpCount = %d, want 2", got)
+	}
+
+	multisig := append([]byte{OP_3}, OP_CHECKMULTISIG)
+	if got := GetSigOpCount(1, multisig); got != 20 {
+		t.Fatalf("GetSigOpCount on an unpreceded CHECKMULTISIG = %d, want the worst-case 20", got)
+	}
+}
+
+func TestGetPreciseSigOpCount(t *testing.T) {
+	script := append([]byte{OP_3}, OP_CHECKMULTISIG)
+	if got := GetPreciseSigOpCount(1, script, nil); got != 3 {
+		t.Fatalf("GetPreciseSigOpCount = %d, want 3", got)
+	}
+}
+
+// TestGetPreciseSigOpCountPayToContract covers the case script alone can't
+// answer: a P2C output only commits to a hash of its contract program, so
+// the real sigop count is hiding in whatever program sigScript supplies at
+// spend time.
+func TestGetPreciseSigOpCountPayToContract(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xAB}, 32)
+	p2c := append([]byte{byte(len(hash))}, hash...)
+	p2c = append(p2c, OP_CHECKPREDICATE)
+
+	pubKeys := [][]byte{testPubKey(0x02), testPubKey(0x03), testPubKey(0x02)}
+	program := multisigScript(2, pubKeys, 3)
+	// The program is longer than a direct push can carry, so use OP_PUSHDATA1.
+	sigScript := append([]byte{OP_PUSHDATA1, byte(len(program))}, program...)
+
+	if got := GetSigOpCount(1, p2c); got != 0 {
+		t.Fatalf("GetSigOpCount on the P2C pkScript alone = %d, want 0 (it only commits to a hash)", got)
+	}
+	if got := GetPreciseSigOpCount(1, p2c, sigScript); got != 3 {
+		t.Fatalf("GetPreciseSigOpCount = %d, want 3 (the pubkey count from the real program in sigScript)", got)
+	}
+
+	if got := GetPreciseSigOpCount(1, p2c, []byte{OP_CHECKSIG}); got != 0 {
+		t.Fatalf("GetPreciseSigOpCount with a non-push-only sigScript = %d, want 0", got)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"container/list"
+	"sync"
+
+	"chain/cos/bc"
+)
+
+// SigCache caches the result of signature verifications so that a signature
+// checked once (for example, during mempool or pool acceptance) doesn't have
+// to pay for the curve math again when the same transaction is later
+// re-verified at block-connect time.
+//
+// Implementations must be safe for concurrent use. Callers must only Add an
+// entry once the transaction containing the signature is known to be
+// otherwise valid: adding an entry for a signature that hasn't actually been
+// verified would let a malformed transaction poison the cache for anyone who
+// later asks Exists about the same (sigHash, sig, pubKey) triple.
+type SigCache interface {
+	// Exists returns whether sig/pubKey have already been verified
+	// against sigHash.
+	Exists(sigHash bc.Hash, sig, pubKey []byte) bool
+
+	// Add records that sig/pubKey verified successfully against sigHash.
+	Add(sigHash bc.Hash, sig, pubKey []byte)
+}
+
+// sigCacheKey identifies one verified (sigHash, sig, pubKey) triple. Sig and
+// pubKey are folded into the key as strings (rather than kept as the slices
+// that were passed in) so the cache doesn't hold a reference to caller
+// buffers and so the key is comparable for use as a map key.
+type sigCacheKey struct {
+	sigHash bc.Hash
+	sig     string
+	pubKey  string
+}
+
+// lruSigCache is a SigCache backed by a fixed-size LRU: once maxEntries
+// entries are cached, adding a new one evicts the least recently used.
+type lruSigCache struct {
+	mu         sync.Mutex
+	maxEntries uint
+	entries    map[sigCacheKey]*list.Element
+	lru        *list.List // front = most recently used
+}
+
+// NewSigCache returns a SigCache that holds at most maxEntries verified
+// signatures, evicting the least recently used entry once full.
+func NewSigCache(maxEntries uint) SigCache {
+	return &lruSigCache{
+		maxEntries: maxEntries,
+		entries:    make(map[sigCacheKey]*list.Element, maxEntries),
+		lru:        list.New(),
+	}
+}
+
+func (c *lruSigCache) key(sigHash bc.Hash, sig, pubKey []byte) sigCacheKey {
+	return sigCacheKey{sigHash: sigHash, sig: string(sig), pubKey: string(pubKey)}
+}
+
+// Exists returns whether sig/pubKey have already been verified against
+// sigHash, moving the entry to the front of the LRU if so.
+func (c *lruSigCache) Exists(sigHash bc.Hash, sig, pubKey []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[c.key(sigHash, sig, pubKey)]
+	if !ok {
+		return false
+	}
+	c.lru.MoveToFront(elem)
+	return true
+}
+
+// Add records that sig/pubKey verified successfully against sigHash,
+// evicting the least recently used entry if the cache is already full.
+func (c *lruSigCache) Add(sigHash bc.Hash, sig, pubKey []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxEntries == 0 {
+		return
+	}
+
+	k := c.key(sigHash, sig, pubKey)
+	if elem, ok := c.entries[k]; ok {
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	if uint(c.lru.Len()) >= c.maxEntries {
+		oldest := c.lru.Back()
+		if oldest != nil {
+			c.lru.Remove(oldest)
+			delete(c.entries, oldest.Value.(sigCacheKey))
+		}
+	}
+
+	c.entries[k] = c.lru.PushFront(k)
+}
+
+// EngineOption customizes an Engine returned by NewReusableEngine,
+// NewEngine, or NewEngineForBlock.
+type EngineOption func(*Engine)
+
+// WithSigCache arms vm to consult cache before doing signature-verification
+// curve math, and to populate it on success. A single SigCache can and
+// should be shared across every Engine validating a block or mempool, since
+// that's what lets already-verified signatures short-circuit.
+func WithSigCache(cache SigCache) EngineOption {
+	return func(vm *Engine) {
+		vm.sigCache = cache
+	}
+}
+
+// checkSig consults vm's SigCache (if any) for sig/pubKey against sigHash,
+// calling verify to do the actual curve math only on a cache miss. On a
+// successful verify, the result is recorded in the cache. This is the single
+// choke point OP_CHECKSIG and OP_CHECKMULTISIG should call through so the
+// caching behavior lives in one place.
+func (vm *Engine) checkSig(sigHash bc.Hash, sig, pubKey []byte, verify func() bool) bool {
+	if vm.sigCache != nil && vm.sigCache.Exists(sigHash, sig, pubKey) {
+		return true
+	}
+
+	ok := verify()
+	if ok && vm.sigCache != nil {
+		vm.sigCache.Add(sigHash, sig, pubKey)
+	}
+	return ok
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"testing"
+
+	"chain/cos/bc"
+)
+
+func TestSigCacheExistsAdd(t *testing.T) {
+	cache := NewSigCache(10)
+	hash := bc.Hash{0x01}
+	sig, pubKey := []byte("sig"), []byte("pubKey")
+
+	if cache.Exists(hash, sig, pubKey) {
+		t.Fatal("Exists = true before Add")
+	}
+	cache.Add(hash, sig, pubKey)
+	if !cache.Exists(hash, sig, pubKey) {
+		t.Fatal("Exists = false after Add")
+	}
+
+	if cache.Exists(hash, sig, []byte("other")) {
+		t.Fatal("Exists = true for a different pubkey")
+	}
+}
+
+func TestSigCacheEviction(t *testing.T) {
+	cache := NewSigCache(2)
+	h1, h2, h3 := bc.Hash{0x01}, bc.Hash{0x02}, bc.Hash{0x03}
+	sig, pubKey := []byte("sig"), []byte("pubKey")
+
+	cache.Add(h1, sig, pubKey)
+	cache.Add(h2, sig, pubKey)
+	cache.Add(h3, sig, pubKey) // cache is full; evicts h1, the least recently used
+
+	if cache.Exists(h1, sig, pubKey) {
+		t.Fatal("Exists = true for an entry that should have been evicted")
+	}
+	if !cache.Exists(h2, sig, pubKey) || !cache.Exists(h3, sig, pubKey) {
+		t.Fatal("Exists = false for an entry that should still be cached")
+	}
+}
+
+func TestSigCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewSigCache(2)
+	h1, h2, h3 := bc.Hash{0x01}, bc.Hash{0x02}, bc.Hash{0x03}
+	sig, pubKey := []byte("sig"), []byte("pubKey")
+
+	cache.Add(h1, sig, pubKey)
+	cache.Add(h2, sig, pubKey)
+	cache.Exists(h1, sig, pubKey) // touch h1 so h2 becomes the least recently used
+	cache.Add(h3, sig, pubKey)    // evicts h2, not h1
+
+	if !cache.Exists(h1, sig, pubKey) {
+		t.Fatal("Exists = false for the recently touched entry, want it to have survived eviction")
+	}
+	if cache.Exists(h2, sig, pubKey) {
+		t.Fatal("Exists = true for the entry that should have been evicted")
+	}
+}
+
+func TestSigCacheZeroMaxEntries(t *testing.T) {
+	cache := NewSigCache(0)
+	hash := bc.Hash{0x01}
+	sig, pubKey := []byte("sig"), []byte("pubKey")
+
+	cache.Add(hash, sig, pubKey)
+	if cache.Exists(hash, sig, pubKey) {
+		t.Fatal("Exists = true after Add on a zero-capacity cache")
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+// stackFrame holds the state the engine needs to keep executing a single
+// script.  Rather than a slice of pre-parsed opcodes, a frame now wraps a
+// scriptTokenizer over the raw script bytes, so pushing a frame for
+// OP_CHECKPREDICATE no longer allocates anything beyond the tokenizer value
+// itself.
+type stackFrame struct {
+	tok         scriptTokenizer
+	condStack   []int
+	lastCodeSep int32 // offset, in bytes, just after the most recent executed OP_CODESEPARATOR
+	scriptIdx   int   // this frame's stable index into vm.scripts, set once when the frame is pushed
+	finished    bool  // set once step has moved past the script's last opcode
+}
+
+// opcode returns the opcode the tokenizer is currently positioned on.
+func (f *stackFrame) opcode() byte {
+	return f.tok.Opcode()
+}
+
+// data returns the data push, if any, associated with the current opcode.
+func (f *stackFrame) data() []byte {
+	return f.tok.Data()
+}
+
+// step advances the frame's tokenizer to the next opcode.
+func (f *stackFrame) step() bool {
+	if !f.tok.Next() {
+		f.finished = true
+		return false
+	}
+	return true
+}
+
+// done reports whether the frame has stepped past its script's last opcode.
+// The tokenizer's own Done is already true while the frame is positioned on
+// that last opcode, before it has executed, so it is not used here.
+func (f *stackFrame) done() bool {
+	return f.finished
+}
+
+// byteIndex returns the current byte offset into the frame's script.
+func (f *stackFrame) byteIndex() int32 {
+	return f.tok.ByteIndex()
+}
+
+// script returns the raw bytes backing this frame, for disassembly and error
+// reporting.
+func (f *stackFrame) script() []byte {
+	return f.tok.script
+}
+
+// scriptStack is the engine's execution stack: one frame per script pushed
+// by Prepare or OP_CHECKPREDICATE.
+type scriptStack struct {
+	frames []*stackFrame
+}
+
+// Push adds a new frame to the top of the execution stack.
+func (s *scriptStack) Push(f *stackFrame) {
+	s.frames = append(s.frames, f)
+}
+
+// Peek returns the frame on top of the execution stack.
+func (s *scriptStack) Peek() *stackFrame {
+	return s.frames[len(s.frames)-1]
+}
+
+// Depth returns the number of frames currently on the execution stack.
+func (s *scriptStack) Depth() int32 {
+	return int32(len(s.frames))
+}
+
+// empty reports whether the execution stack has no frames left.
+func (s *scriptStack) empty() bool {
+	return len(s.frames) == 0
+}
+
+// Reset clears the execution stack so the engine can be reused.
+func (s *scriptStack) Reset() {
+	s.frames = s.frames[:0]
+}
+
+// curPC returns the current frame's stable vm.scripts index, along with the
+// byte offset its tokenizer is positioned at. The script index is NOT the
+// frame's depth in the execution stack: frames are popped as child scripts
+// finish, so two sibling scripts pushed one after another (e.g. two
+// OP_CHECKPREDICATE calls at the same call depth) would land at the same
+// depth but must still be distinguishable here, since it's what breakpoints
+// and Trace identify a script by.
+func (s *scriptStack) curPC() (int, int32, error) {
+	if s.empty() {
+		return 0, 0, ErrStackScriptUnfinished
+	}
+	frame := s.Peek()
+	return frame.scriptIdx, frame.byteIndex(), nil
+}
+
+// nextFrame pops finished frames off the top of the execution stack until it
+// finds one that still has opcodes left to execute, or the stack is empty.
+// It returns true (done) once no frames remain.
+func (s *scriptStack) nextFrame() (bool, error) {
+	for !s.empty() && s.Peek().done() {
+		s.frames = s.frames[:len(s.frames)-1]
+	}
+	return s.empty(), nil
+}
+
+// disasm returns the disassembly string for the opcode the current (top)
+// frame's tokenizer is positioned on. DisasmPC only ever describes the
+// frame that's actually executing, so there's no need to address any other
+// frame by index.
+func (s *scriptStack) disasm(off int32) string {
+	return s.Peek().disasmAt(off)
+}
+
+// disasmAt returns the disassembly string for the opcode at the given byte
+// offset, driven off a scratch tokenizer over this frame's script so it
+// doesn't disturb the frame's own execution position.
+//
+// off is a post-decode offset, i.e. the value ByteIndex reports once the
+// opcode in question has been decoded (as it is for the frame's own
+// tokenizer, which steps one opcode ahead eagerly). So the scratch tokenizer
+// just needs to decode opcodes until its own offset reaches off; whatever it
+// last decoded getting there is the opcode being described, with no further
+// Next() call needed.
+func (f *stackFrame) disasmAt(off int32) string {
+	tok := makeScriptTokenizer(f.tok.version, f.tok.script)
+	decoded := false
+	for !decoded || int32(tok.offset) < off {
+		if !tok.Next() {
+			return ""
+		}
+		decoded = true
+	}
+	return disasmOpcode(tok.Opcode(), tok.Data())
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import "testing"
+
+// TestDisasmPC is a regression test for an off-by-one in disasmAt: it was
+// decoding one opcode past the one the frame's own tokenizer was positioned
+// on, so DisasmPC (and Trace's NextOpcode) described the wrong instruction.
+func TestDisasmPC(t *testing.T) {
+	script := []byte{OP_1, OP_2, OP_CHECKSIG}
+
+	vm := &Engine{}
+	if err := vm.PushScript(script); err != nil {
+		t.Fatalf("PushScript: %v", err)
+	}
+
+	dis, err := vm.DisasmPC()
+	if err != nil {
+		t.Fatalf("DisasmPC: %v", err)
+	}
+	if want := disasmOpcode(OP_1, nil); dis != want {
+		t.Fatalf("DisasmPC before any Step = %q, want %q (the first opcode)", dis, want)
+	}
+
+	if done, err := vm.Step(); done || err != nil {
+		t.Fatalf("Step = (%v, %v), want (false, nil)", done, err)
+	}
+	dis, err = vm.DisasmPC()
+	if err != nil {
+		t.Fatalf("DisasmPC: %v", err)
+	}
+	if want := disasmOpcode(OP_2, nil); dis != want {
+		t.Fatalf("DisasmPC after one Step = %q, want %q (the second opcode)", dis, want)
+	}
+}
+
+// TestDisasmPCSingleOpcodeScript is a regression test for disasmAt returning
+// "" for a one-opcode script instead of disassembling that opcode, which
+// happened because the off=0 case never entered the loop that decoded it.
+func TestDisasmPCSingleOpcodeScript(t *testing.T) {
+	vm := &Engine{}
+	if err := vm.PushScript([]byte{OP_CHECKSIG}); err != nil {
+		t.Fatalf("PushScript: %v", err)
+	}
+
+	dis, err := vm.DisasmPC()
+	if err != nil {
+		t.Fatalf("DisasmPC: %v", err)
+	}
+	if want := disasmOpcode(OP_CHECKSIG, nil); dis != want {
+		t.Fatalf("DisasmPC for a single-opcode script = %q, want %q", dis, want)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import "fmt"
+
+// scriptTokenizer provides a facility for easily and efficiently tokenizing
+// transaction scripts without creating allocations for the individual opcodes
+// and data pushes as parseScript used to do.  Each call to Next decodes a
+// single opcode (and its associated data push, if any) in place, so a
+// tokenizer walking an N-opcode script performs zero heap allocations of its
+// own.
+//
+// Typical usage is:
+//
+//	tok := makeScriptTokenizer(version, script)
+//	for tok.Next() {
+//		// inspect tok.Opcode() / tok.Data()
+//	}
+//	if err := tok.Err(); err != nil {
+//		// handle parse failure
+//	}
+type scriptTokenizer struct {
+	script  []byte
+	version uint16
+	offset  int32
+	opcode  byte
+	data    []byte
+	err     error
+}
+
+// makeScriptTokenizer returns a new tokenizer ready to walk the passed
+// script, starting at offset zero.
+func makeScriptTokenizer(version uint16, script []byte) scriptTokenizer {
+	return scriptTokenizer{script: script, version: version}
+}
+
+// Done returns true when the tokenizer has reached the end of the script or
+// has encountered a parse error, in which case no further calls to Next will
+// make progress.
+func (t *scriptTokenizer) Done() bool {
+	return t.err != nil || int(t.offset) >= len(t.script)
+}
+
+// Next attempts to decode the next opcode in the script and returns whether
+// or not it succeeded.  It does not allocate: Opcode and Data are valid views
+// into the original script slice until the following call to Next.
+func (t *scriptTokenizer) Next() bool {
+	if t.Done() {
+		return false
+	}
+
+	op := t.script[t.offset]
+	switch {
+	case op > OP_16:
+		// No associated data push.
+		t.opcode = op
+		t.data = nil
+		t.offset++
+		return true
+
+	case op < OP_PUSHDATA1:
+		// Direct push of op bytes of data.
+		start := t.offset + 1
+		end := start + int32(op)
+		if end > int32(len(t.script)) {
+			t.err = scriptError(ErrShortScript, fmt.Sprintf("script claims %d bytes of data at offset %d but only %d remain", end-start, t.offset, int32(len(t.script))-start))
+			return false
+		}
+		t.opcode = op
+		t.data = t.script[start:end]
+		t.offset = end
+		return true
+
+	default:
+		dataLen, hdrLen, err := pushDataLen(t.version, op, t.script[t.offset:])
+		if err != nil {
+			t.err = err
+			return false
+		}
+		start := t.offset + hdrLen
+		end := start + dataLen
+		if end > int32(len(t.script)) {
+			t.err = scriptError(ErrShortScript, fmt.Sprintf("script claims %d bytes of data at offset %d but only %d remain", end-start, t.offset, int32(len(t.script))-start))
+			return false
+		}
+		t.opcode = op
+		t.data = t.script[start:end]
+		t.offset = end
+		return true
+	}
+}
+
+// Opcode returns the opcode decoded by the most recent successful call to
+// Next.
+func (t *scriptTokenizer) Opcode() byte {
+	return t.opcode
+}
+
+// Data returns the data pushed by the most recent successful call to Next,
+// or nil if that opcode does not push data.
+func (t *scriptTokenizer) Data() []byte {
+	return t.data
+}
+
+// ByteIndex returns the current offset, in bytes, into the script.  This is
+// the offset that OP_CODESEPARATOR and breakpoints are expressed in terms
+// of.
+func (t *scriptTokenizer) ByteIndex() int32 {
+	return t.offset
+}
+
+// Err returns the error, if any, that caused tokenization to stop early.
+func (t *scriptTokenizer) Err() error {
+	return t.err
+}
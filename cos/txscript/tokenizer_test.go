@@ -0,0 +1,72 @@
+// Copyright (c) 2013-2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import "testing"
+
+func TestScriptTokenizerNext(t *testing.T) {
+	script := []byte{OP_1, 0x02, 0xAB, 0xCD, OP_CHECKSIG}
+
+	tok := makeScriptTokenizer(1, script)
+
+	if !tok.Next() || tok.Opcode() != OP_1 || tok.Data() != nil {
+		t.Fatalf("first opcode = (%v, %x), want (OP_1, nil)", tok.Opcode(), tok.Data())
+	}
+	if tok.ByteIndex() != 1 {
+		t.Fatalf("ByteIndex after OP_1 = %d, want 1", tok.ByteIndex())
+	}
+
+	if !tok.Next() || tok.Opcode() != 0x02 || string(tok.Data()) != "\xAB\xCD" {
+		t.Fatalf("second opcode = (%v, %x), want (0x02, abcd)", tok.Opcode(), tok.Data())
+	}
+	if tok.ByteIndex() != 4 {
+		t.Fatalf("ByteIndex after the data push = %d, want 4", tok.ByteIndex())
+	}
+
+	if !tok.Next() || tok.Opcode() != OP_CHECKSIG {
+		t.Fatalf("third opcode = %v, want OP_CHECKSIG", tok.Opcode())
+	}
+
+	if tok.Next() {
+		t.Fatal("Next = true past the end of the script")
+	}
+	if !tok.Done() {
+		t.Fatal("Done = false past the end of the script")
+	}
+	if err := tok.Err(); err != nil {
+		t.Fatalf("Err = %v for a well-formed script, want nil", err)
+	}
+}
+
+func TestScriptTokenizerDone(t *testing.T) {
+	tok := makeScriptTokenizer(1, nil)
+	if !tok.Done() {
+		t.Fatal("Done = false for an empty script")
+	}
+	if tok.Next() {
+		t.Fatal("Next = true for an empty script")
+	}
+}
+
+func TestScriptTokenizerShortScript(t *testing.T) {
+	// Claims two bytes of data but only one remains.
+	script := []byte{0x02, 0xAB}
+
+	tok := makeScriptTokenizer(1, script)
+	if tok.Next() {
+		t.Fatal("Next = true for a short script")
+	}
+	if !tok.Done() {
+		t.Fatal("Done = false once tokenizing has failed")
+	}
+
+	e, ok := tok.Err().(Error)
+	if !ok {
+		t.Fatalf("Err() = %v (%T), want a txscript.Error", tok.Err(), tok.Err())
+	}
+	if e.ErrorCode != ErrShortScript {
+		t.Fatalf("Err().ErrorCode = %v, want ErrShortScript", e.ErrorCode)
+	}
+}